@@ -0,0 +1,243 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metamorphic
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Clone returns an independent copy of s. RunConcurrent uses Clone to fork
+// off candidate sequential states while searching for a linearization,
+// without perturbing the state under test.
+type Clone[S any] func(S) S
+
+// maxLinearizeSteps bounds the number of states the linearizability
+// search in RunConcurrent will visit, so that an ambiguous or genuinely
+// non-linearizable history can't hang the search (and CI) indefinitely.
+// It's a var, rather than a const, so tests can shrink it to exercise the
+// cap without needing a combinatorially large history.
+var maxLinearizeSteps = 200_000
+
+// RunConcurrent dispatches ops across workers goroutines that apply
+// operations directly to the shared state s, exercising s's own
+// thread-safety, and records the real-time span and logged output of
+// every op. Once all ops have run, RunConcurrent checks that the
+// resulting concurrent history is linearizable: it searches for some
+// total order of ops, consistent with the real-time order in which they
+// were observed to run, under which replaying ops one at a time against a
+// freshly cloned copy of initial reproduces the output recorded for each
+// op (per outputsEqual). If no such order exists, RunConcurrent fails t
+// and dumps the full concurrent history. The search gives up after
+// maxLinearizeSteps candidate states without finding or ruling out an
+// order, logging that fact to t rather than failing it, since a capped
+// search can't distinguish "non-linearizable" from "not yet explored".
+//
+// clone must return an independent copy of its argument; hash must return
+// a value equal for any two states clone considers equal, so that the
+// search can memoize states it's already visited -- for a pointer-typed
+// S, this means hashing the pointed-to value, not the pointer itself.
+// RunConcurrent requires ops to be safe to run concurrently against s,
+// and hands each op, in order, to whichever worker is next free to take
+// it.
+func RunConcurrent[S any](
+	t testing.TB,
+	initial S,
+	workers int,
+	ops []Op[S],
+	clone Clone[S],
+	hash func(S) string,
+	outputsEqual func(a, b string) bool,
+) {
+	if workers < 1 {
+		workers = 1
+	}
+	// Snapshot initial before dispatching ops, since s is mutated in place
+	// by the concurrent run below and linearize needs the state as it was
+	// before any op ran.
+	initialSnapshot := clone(initial)
+	s := initial
+	events := make([]*concurrentEvent[S], len(ops))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := range work {
+				events[i] = runConcurrentOp(worker, ops[i], s)
+			}
+		}(w)
+	}
+	for i := range ops {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	order, capped, ok := linearize(events, initialSnapshot, clone, hash, outputsEqual)
+	if ok {
+		t.Logf("linearized order: %v", order)
+		return
+	}
+	if capped {
+		t.Logf("linearization search exceeded %d steps without finding or ruling out a valid order for %d ops; skipping the linearizability check for this run",
+			maxLinearizeSteps, len(ops))
+		return
+	}
+	var sb strings.Builder
+	for _, e := range events {
+		fmt.Fprintf(&sb, "worker %d: [%s, %s] %s = %q\n",
+			e.worker, e.start.Format(time.RFC3339Nano), e.end.Format(time.RFC3339Nano), e.op, e.output)
+	}
+	t.Errorf("concurrent history is not linearizable:\n%s", sb.String())
+}
+
+// concurrentEvent records the real-time span and observed output of a
+// single operation invocation during a RunConcurrent run.
+type concurrentEvent[S any] struct {
+	op         Op[S]
+	worker     int
+	start, end time.Time
+	output     string
+	panicked   bool
+}
+
+// runConcurrentOp applies op to s, recording its real-time span and the
+// output it logs (or the panic it raises) to an isolated, per-call
+// Logger.
+func runConcurrentOp[S any](worker int, op Op[S], s S) *concurrentEvent[S] {
+	ev := &concurrentEvent[S]{op: op, worker: worker, start: time.Now()}
+	l := newIsolatedLogger()
+	ev.output, ev.panicked = applyOp(l, op, s)
+	ev.end = time.Now()
+	return ev
+}
+
+// newIsolatedLogger constructs a *Logger that only buffers its history in
+// memory and isn't associated with a testing.TB, for use when applying an
+// op outside of the context of Run/RunInTandem.
+func newIsolatedLogger() *Logger {
+	l := &Logger{}
+	l.w = &l.history
+	l.wIndent = newlineIndentingWriter{Writer: l.w, indent: []byte("  ")}
+	return l
+}
+
+// applyOp runs op against s using l, returning the text it logged and
+// whether it panicked.
+func applyOp[S any](l *Logger, op Op[S], s S) (output string, panicked bool) {
+	defer func() {
+		output = l.history.String()
+		if r := recover(); r != nil {
+			panicked = true
+		}
+	}()
+	op.Run(l, s)
+	return
+}
+
+// linearize searches for a total order of events, consistent with the
+// real-time order in which they were observed to start and finish, under
+// which replaying them one at a time against a clone of initial
+// reproduces every event's recorded output. It returns the order found,
+// if any, as indexes into events; capped reports whether the search was
+// abandoned after maxLinearizeSteps without reaching a conclusion.
+func linearize[S any](
+	events []*concurrentEvent[S], initial S, clone Clone[S], hash func(S) string, outputsEqual func(a, b string) bool,
+) (order []int, capped bool, ok bool) {
+	pending := make([]int, len(events))
+	for i := range pending {
+		pending[i] = i
+	}
+	search := &linearizeSearch[S]{
+		events:       events,
+		clone:        clone,
+		hash:         hash,
+		outputsEqual: outputsEqual,
+		memo:         make(map[string]bool),
+	}
+	order, ok = search.run(pending, clone(initial))
+	return order, !ok && search.capped, ok
+}
+
+// linearizeSearch holds the state threaded through the recursive
+// linearizability search: the memo table of dead-end (pending-set, state)
+// pairs already explored, and a step counter used to bound the search.
+type linearizeSearch[S any] struct {
+	events       []*concurrentEvent[S]
+	clone        Clone[S]
+	hash         func(S) string
+	outputsEqual func(a, b string) bool
+	memo         map[string]bool
+	steps        int
+	// capped is set once the search has turned away a state because it
+	// already visited maxLinearizeSteps states.
+	capped bool
+}
+
+func (search *linearizeSearch[S]) run(pending []int, state S) ([]int, bool) {
+	if len(pending) == 0 {
+		return nil, true
+	}
+	if search.steps >= maxLinearizeSteps {
+		search.capped = true
+		return nil, false
+	}
+	search.steps++
+	key := fmt.Sprintf("%v|%s", pending, search.hash(state))
+	if search.memo[key] {
+		return nil, false
+	}
+	for pi, idx := range pending {
+		e := search.events[idx]
+		if hasNecessaryPredecessor(search.events, pending, idx) {
+			continue
+		}
+		trial := search.clone(state)
+		l := newIsolatedLogger()
+		output, panicked := applyOp(l, e.op, trial)
+		if panicked != e.panicked || !search.outputsEqual(output, e.output) {
+			continue
+		}
+		rest := make([]int, 0, len(pending)-1)
+		rest = append(rest, pending[:pi]...)
+		rest = append(rest, pending[pi+1:]...)
+		if tail, ok := search.run(rest, trial); ok {
+			return append([]int{idx}, tail...), true
+		}
+	}
+	search.memo[key] = true
+	return nil, false
+}
+
+// hasNecessaryPredecessor reports whether some other pending event must,
+// by the real-time order observed, be linearized before idx: namely, any
+// pending event that had already finished before idx's call began.
+func hasNecessaryPredecessor[S any](events []*concurrentEvent[S], pending []int, idx int) bool {
+	e := events[idx]
+	for _, j := range pending {
+		if j == idx {
+			continue
+		}
+		if !events[j].end.After(e.start) {
+			return true
+		}
+	}
+	return false
+}
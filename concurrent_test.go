@@ -0,0 +1,139 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metamorphic
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type counterAddAtomicOp struct{ delta int64 }
+
+func (o counterAddAtomicOp) String() string { return fmt.Sprintf("Add(%d)", o.delta) }
+
+func (o counterAddAtomicOp) Run(l *Logger, c *int64) {
+	l.Logf("%d", atomic.AddInt64(c, o.delta))
+}
+
+func TestRunConcurrent(t *testing.T) {
+	var c int64
+	ops := []Op[*int64]{
+		counterAddAtomicOp{delta: 1},
+		counterAddAtomicOp{delta: 2},
+		counterAddAtomicOp{delta: 3},
+		counterAddAtomicOp{delta: 4},
+	}
+	clone := func(v *int64) *int64 {
+		nv := *v
+		return &nv
+	}
+	hash := func(v *int64) string { return fmt.Sprintf("%d", *v) }
+	outputsEqual := func(a, b string) bool { return a == b }
+	RunConcurrent(t, &c, 2, ops, clone, hash, outputsEqual)
+}
+
+// TestLinearize_MemoByValue verifies that the linearization search
+// memoizes on the state's hashed value, not its pointer address: every
+// candidate state the search tries comes from a fresh clone(), so if the
+// memo key were derived from the pointer itself (eg, via %v on a *int64),
+// the same logical state would get a new map entry every time, and the
+// memo would never fire.
+func TestLinearize_MemoByValue(t *testing.T) {
+	// An event whose expected output never matches, so that run([0], ...)
+	// is always a dead end and gets recorded in the memo.
+	events := []*concurrentEvent[*int64]{
+		{op: counterAddAtomicOp{delta: 1}, output: "not a real output"},
+	}
+	clone := func(v *int64) *int64 {
+		nv := *v
+		return &nv
+	}
+	hash := func(v *int64) string { return fmt.Sprintf("%d", *v) }
+	outputsEqual := func(a, b string) bool { return a == b }
+	search := &linearizeSearch[*int64]{
+		events: events, clone: clone, hash: hash, outputsEqual: outputsEqual,
+		memo: make(map[string]bool),
+	}
+
+	v1, v2 := int64(0), int64(0) // distinct pointers to equal values
+	if _, ok := search.run([]int{0}, &v1); ok {
+		t.Fatalf("expected a dead end")
+	}
+	if len(search.memo) != 1 {
+		t.Fatalf("expected exactly one memo entry after the first dead end, got %d", len(search.memo))
+	}
+	if _, ok := search.run([]int{0}, &v2); ok {
+		t.Fatalf("expected a dead end")
+	}
+	if len(search.memo) != 1 {
+		t.Errorf("memoizing by pointer address instead of hashed value: got %d memo entries "+
+			"after revisiting an equal state through a different pointer, want 1", len(search.memo))
+	}
+}
+
+// TestLinearize_StepCap verifies that the search gives up, rather than
+// exhaustively exploring, once it visits maxLinearizeSteps states, so
+// that a non-linearizable (or merely large) history can't hang the
+// search indefinitely.
+func TestLinearize_StepCap(t *testing.T) {
+	// Capture the per-op outputs of applying deltas 1, 2, 3, 4 in that
+	// order, starting from zero, then corrupt the last one so that no
+	// order of these four events can ever be linearized: the search must
+	// walk several levels deep (matching 1, then 2, then 3) before
+	// discovering the corrupted fourth output can't be reproduced.
+	var c int64
+	ops := []Op[*int64]{
+		counterAddAtomicOp{delta: 1},
+		counterAddAtomicOp{delta: 2},
+		counterAddAtomicOp{delta: 3},
+		counterAddAtomicOp{delta: 4},
+	}
+	events := make([]*concurrentEvent[*int64], len(ops))
+	for i, op := range ops {
+		events[i] = runConcurrentOp(0, op, &c)
+	}
+	events[3].output = "not a real output"
+
+	// Mark all four as having overlapped in real time, so every order of
+	// them is consistent with the observed history and the search can't
+	// shortcut via hasNecessaryPredecessor.
+	now := time.Now()
+	for _, e := range events {
+		e.start, e.end = now, now.Add(10*time.Millisecond)
+	}
+
+	clone := func(v *int64) *int64 {
+		nv := *v
+		return &nv
+	}
+	hash := func(v *int64) string { return fmt.Sprintf("%d", *v) }
+	outputsEqual := func(a, b string) bool { return a == b }
+	var zero int64
+
+	saved := maxLinearizeSteps
+	defer func() { maxLinearizeSteps = saved }()
+
+	maxLinearizeSteps = 1_000_000
+	if _, capped, ok := linearize(events, &zero, clone, hash, outputsEqual); ok || capped {
+		t.Fatalf("ok=%v capped=%v, want ok=false capped=false with a generous step budget", ok, capped)
+	}
+
+	maxLinearizeSteps = 2
+	if _, capped, ok := linearize(events, &zero, clone, hash, outputsEqual); ok || !capped {
+		t.Errorf("ok=%v capped=%v, want ok=false capped=true with a step budget of %d", ok, capped, maxLinearizeSteps)
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"os"
 	"testing"
 
 	"github.com/cockroachdb/errors"
@@ -39,15 +40,38 @@ func Generate[I any](n int, fn func() I) []I {
 	return items
 }
 
-// NewLogger constructs a new logger for running randomized tests.
-func NewLogger(t testing.TB) *Logger {
+// NewLogger constructs a new logger for running randomized tests. By
+// default the logger only retains its history in memory, accessible via
+// (*Logger).History; pass a LoggerOption such as TeeToFile to additionally
+// persist it elsewhere.
+func NewLogger(t testing.TB, opts ...LoggerOption) *Logger {
 	l := &Logger{t: t}
-	// TODO(jackson): Support teeing to additional sink(s), eg, a file.
 	l.w = &l.history
+	for _, opt := range opts {
+		opt(l)
+	}
 	l.wIndent = newlineIndentingWriter{Writer: l.w, indent: []byte("  ")}
 	return l
 }
 
+// LoggerOption configures a *Logger constructed by NewLogger.
+type LoggerOption func(*Logger)
+
+// TeeToFile returns a LoggerOption that additionally writes the logger's
+// human-readable history to the named file as it's produced. The file is
+// closed automatically when t finishes, via t.Cleanup.
+func TeeToFile(path string) LoggerOption {
+	return func(l *Logger) {
+		f, err := os.Create(path)
+		if err != nil {
+			l.t.Fatalf("opening tee file %q: %s", path, err)
+			return
+		}
+		l.t.Cleanup(func() { _ = f.Close() })
+		l.w = io.MultiWriter(&l.history, f)
+	}
+}
+
 // Step runs the provided operation against the provided state.
 func Step[S any](l *Logger, s S, op Op[S]) {
 	// Ensure panics result in printing the history.
@@ -0,0 +1,125 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package seq
+
+import "time"
+
+// RateLimit returns a sequence that paces calls to inner.Next to no more
+// often than once every 1/opsPerSecond, so that a caller driving inner as
+// fast as possible is instead limited to approximately opsPerSecond calls
+// per second. This keeps long metamorphic runs from saturating I/O-bound
+// systems under test. Pacing is a fixed, per-call interval rather than a
+// token bucket: it doesn't accumulate unused capacity from idle periods
+// into bursts of faster-than-opsPerSecond calls later. RateLimit panics
+// if opsPerSecond isn't positive.
+func RateLimit[I any](inner Sequence[I], opsPerSecond float64) Sequence[I] {
+	if opsPerSecond <= 0 {
+		panic("seq: RateLimit requires opsPerSecond > 0")
+	}
+	return &rateLimited[I]{
+		sequence: inner,
+		interval: time.Duration(float64(time.Second) / opsPerSecond),
+	}
+}
+
+type rateLimited[I any] struct {
+	sequence Sequence[I]
+	interval time.Duration
+	last     time.Time
+}
+
+// Next implements Sequence.
+func (s *rateLimited[I]) Next() (I, bool) {
+	if !s.last.IsZero() {
+		if wait := s.interval - time.Since(s.last); wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+	next, restarted := s.sequence.Next()
+	s.last = time.Now()
+	return next, restarted
+}
+
+// Deadline returns a sequence that forwards to inner until the duration d
+// has elapsed since the first call to Next, at which point it reports
+// itself exhausted: it implements Exhaustible, and once the deadline has
+// passed, Next returns restarted = true without consulting inner again.
+// This lets Run/RunInTandem-style drivers terminate cleanly on a wall-
+// clock time budget rather than a fixed op count.
+func Deadline[I any](inner Sequence[I], d time.Duration) Sequence[I] {
+	return &deadline[I]{sequence: inner, budget: d}
+}
+
+type deadline[I any] struct {
+	sequence Sequence[I]
+	budget   time.Duration
+	deadline time.Time
+}
+
+// Next implements Sequence.
+func (s *deadline[I]) Next() (next I, restarted bool) {
+	if s.deadline.IsZero() {
+		s.deadline = time.Now().Add(s.budget)
+	}
+	if s.Done() {
+		return next, true
+	}
+	return s.sequence.Next()
+}
+
+// Done implements Exhaustible.
+func (s *deadline[I]) Done() bool {
+	return !s.deadline.IsZero() && !time.Now().Before(s.deadline)
+}
+
+// Monitor tracks an exponentially-weighted moving average of observed
+// throughput, for progress reporting during long-running sequences (eg,
+// one paced by RateLimit or bounded by Deadline).
+type Monitor struct {
+	alpha   float64
+	ema     float64
+	last    time.Time
+	started bool
+}
+
+// NewMonitor constructs a Monitor that maintains an exponentially-
+// weighted moving average of samples recorded via Observe, smoothed using
+// the provided factor alpha, which must be in (0, 1].
+func NewMonitor(alpha float64) *Monitor {
+	return &Monitor{alpha: alpha}
+}
+
+// Observe records a sample of n units (eg, bytes or ops) produced since
+// the previous call to Observe, updating the estimated throughput.
+func (m *Monitor) Observe(n float64) {
+	now := time.Now()
+	if !m.started {
+		m.started = true
+		m.last = now
+		return
+	}
+	elapsed := now.Sub(m.last).Seconds()
+	m.last = now
+	if elapsed <= 0 {
+		return
+	}
+	rate := n / elapsed
+	m.ema = m.alpha*rate + (1-m.alpha)*m.ema
+}
+
+// Rate returns the current estimated throughput, in units per second.
+func (m *Monitor) Rate() float64 {
+	return m.ema
+}
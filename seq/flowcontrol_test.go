@@ -0,0 +1,100 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package seq
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	const opsPerSecond = 50 // one op every 20ms
+	s := RateLimit[int](&Slice[int]{Elems: []int{1, 2, 3, 4, 5}}, opsPerSecond)
+
+	start := time.Now()
+	const n = 5
+	for i := 0; i < n; i++ {
+		s.Next()
+	}
+	elapsed := time.Since(start)
+
+	// The first call shouldn't wait, so n calls should take roughly
+	// (n-1) intervals; allow slack for scheduling jitter but require that
+	// pacing actually slowed the loop down.
+	want := time.Duration(n-1) * time.Second / opsPerSecond
+	if elapsed < want/2 {
+		t.Errorf("RateLimit(%d ops/s) took %s for %d calls, expected at least ~%s", opsPerSecond, elapsed, n, want)
+	}
+}
+
+func TestRateLimit_PanicsOnNonPositive(t *testing.T) {
+	for _, opsPerSecond := range []float64{0, -1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("RateLimit(%v) did not panic", opsPerSecond)
+				}
+			}()
+			RateLimit[int](&Slice[int]{Elems: []int{1}}, opsPerSecond)
+		}()
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	const budget = 20 * time.Millisecond
+	s := Deadline[int](&Slice[int]{Elems: []int{1, 2, 3}}, budget)
+	e, ok := s.(Exhaustible)
+	if !ok {
+		t.Fatalf("Deadline's Sequence doesn't implement Exhaustible")
+	}
+
+	// Drive it until just before its budget elapses (measured from before
+	// its first Next call); it shouldn't report done.
+	deadline := time.Now().Add(budget)
+	for time.Now().Before(deadline) {
+		if _, restarted := s.Next(); restarted && e.Done() {
+			t.Fatalf("Deadline reported exhaustion before its budget elapsed")
+		}
+	}
+
+	// Wait past the budget; it should now report exhaustion, with Next
+	// signaling it via restarted = true.
+	time.Sleep(2 * budget)
+	if _, restarted := s.Next(); !restarted {
+		t.Errorf("Next() restarted = false after the deadline elapsed, want true")
+	}
+	if !e.Done() {
+		t.Errorf("Done() = false after the deadline elapsed, want true")
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	m := NewMonitor(0.5)
+	const (
+		samples  = 20
+		interval = 5 * time.Millisecond
+		perTick  = 100.0 // units observed per interval
+	)
+	for i := 0; i < samples; i++ {
+		time.Sleep(interval)
+		m.Observe(perTick)
+	}
+
+	want := perTick / interval.Seconds()
+	got := m.Rate()
+	if lo, hi := want*0.5, want*1.5; got < lo || got > hi {
+		t.Errorf("Rate() = %f, want within [%f, %f] of steady-state rate %f", got, lo, hi, want)
+	}
+}
@@ -24,6 +24,15 @@ type Sequence[I any] interface {
 	Next() (next I, restarted bool)
 }
 
+// Exhaustible is implemented by Sequence implementations that can report
+// definitively that they've been exhausted, such as Deadline. Callers
+// driving a workload off of a Sequence that may implement Exhaustible
+// should type-assert for it and stop calling Next once Done returns true.
+type Exhaustible interface {
+	// Done reports whether the sequence has been exhausted.
+	Done() bool
+}
+
 // RandomFilter returns a sequence formed by randomly filtering inner, using
 // randomness from rng, returning any individual element with probability p.
 func RandomFilter[I any](inner Sequence[I], rng *rand.Rand, p float64) Sequence[I] {
@@ -0,0 +1,226 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metamorphic
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// failureSignature identifies a failure observed while running an
+// operation sequence, so that Shrink can recognize whether a candidate
+// subsequence still reproduces the same failure as the original sequence,
+// as opposed to some unrelated failure.
+type failureSignature string
+
+// Shrink takes an operation sequence that has been observed to trigger a
+// failure (a panic, or a t.Errorf/t.Fatalf call) when run against
+// newInitial(), and searches for a smaller subsequence that triggers a
+// failure with the same signature. It tries two strategies in turn,
+// repeating until neither makes progress: delta-debugging bisection,
+// which recursively tests halves of the sequence, and one-at-a-time
+// removal, which sweeps the sequence dropping a single op at a time.
+// Shrink logs its progress to t and returns the smallest sequence it
+// found; if ops doesn't already fail, Shrink logs that and returns ops
+// unmodified.
+//
+// newInitial must return a fresh copy of the state that ops originally
+// ran against each time it's called, since candidate subsequences are
+// replayed from scratch. Shrink runs candidates against an internal
+// testing.TB shim so that failures encountered while shrinking don't
+// abort t.
+//
+// To shrink a RunInTandem divergence instead, use ShrinkTandem.
+func Shrink[S any](t testing.TB, newInitial func() S, ops []Op[S]) []Op[S] {
+	return shrink(t, ops, func(candidate []Op[S]) (failureSignature, bool) {
+		return runForShrink(newInitial(), candidate)
+	})
+}
+
+// ShrinkTandem is Shrink's counterpart for a failure observed from
+// RunInTandem: an operation sequence that, when run against
+// newInitial(), produces logs that diverge between two or more of the
+// returned states. ShrinkTandem searches for the smallest subsequence
+// that still produces a divergence with the same signature, using the
+// same bisection and one-at-a-time removal strategies as Shrink.
+//
+// newInitial must return a fresh slice of initial states each time it's
+// called, matching the initial argument originally passed to
+// RunInTandem.
+func ShrinkTandem[S any](t testing.TB, newInitial func() []S, ops []Op[S]) []Op[S] {
+	return shrink(t, ops, func(candidate []Op[S]) (failureSignature, bool) {
+		return runForShrinkTandem(newInitial(), candidate)
+	})
+}
+
+// shrink holds the strategy-agnostic minimization loop shared by Shrink
+// and ShrinkTandem; run reports whether a given candidate sequence
+// reproduces a failure, and if so, that failure's signature.
+func shrink[S any](
+	t testing.TB, ops []Op[S], run func(candidate []Op[S]) (failureSignature, bool),
+) []Op[S] {
+	target, failed := run(ops)
+	if !failed {
+		t.Logf("shrink: the provided sequence of %d ops did not fail; nothing to shrink", len(ops))
+		return ops
+	}
+	t.Logf("shrink: minimizing %d ops (failure: %s)", len(ops), target)
+
+	curr := ops
+	for {
+		next, ok := bisect(run, curr, target)
+		if !ok {
+			next, ok = removeOne(run, curr, target)
+		}
+		if !ok {
+			break
+		}
+		t.Logf("shrink: reduced from %d to %d ops", len(curr), len(next))
+		curr = next
+	}
+	t.Logf("shrink: minimized to %d ops", len(curr))
+	return curr
+}
+
+// bisect implements delta-debugging bisection: it splits ops in half and,
+// for either half that still reproduces target, recurses into that half
+// looking for a smaller failing subsequence.
+func bisect[S any](
+	run func(candidate []Op[S]) (failureSignature, bool), ops []Op[S], target failureSignature,
+) ([]Op[S], bool) {
+	if len(ops) < 2 {
+		return nil, false
+	}
+	mid := len(ops) / 2
+	halves := [2][]Op[S]{ops[:mid], ops[mid:]}
+	for _, half := range halves {
+		if sig, failed := run(half); failed && sig == target {
+			if smaller, ok := bisect(run, half, target); ok {
+				return smaller, true
+			}
+			return half, true
+		}
+	}
+	return nil, false
+}
+
+// removeOne sweeps ops, removing a single op at a time, and returns the
+// first resulting subsequence that still reproduces target.
+func removeOne[S any](
+	run func(candidate []Op[S]) (failureSignature, bool), ops []Op[S], target failureSignature,
+) ([]Op[S], bool) {
+	for i := range ops {
+		candidate := make([]Op[S], 0, len(ops)-1)
+		candidate = append(candidate, ops[:i]...)
+		candidate = append(candidate, ops[i+1:]...)
+		if sig, failed := run(candidate); failed && sig == target {
+			return candidate, true
+		}
+	}
+	return nil, false
+}
+
+// runForShrink runs ops against s in an isolated goroutine, using a
+// shimTB in place of a real testing.TB so that the failure (if any) is
+// captured rather than propagated to the caller's test.
+func runForShrink[S any](s S, ops []Op[S]) (sig failureSignature, failed bool) {
+	shim := &shimTB{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Run(shim, s, ops)
+	}()
+	<-done
+	return shim.signature(), shim.Failed()
+}
+
+// runForShrinkTandem runs ops against states using RunInTandem in an
+// isolated goroutine, using a shimTB so that a divergence (if any) is
+// captured rather than propagated to the caller's test.
+func runForShrinkTandem[S any](states []S, ops []Op[S]) (sig failureSignature, failed bool) {
+	shim := &shimTB{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		RunInTandem(shim, states, ops)
+	}()
+	<-done
+	return shim.signature(), shim.Failed()
+}
+
+// shimTB is a minimal, non-aborting stand-in for testing.TB, used by
+// Shrink to run candidate operation sequences without affecting the
+// caller's test. It embeds testing.TB so that it satisfies the
+// interface's unexported method, but overrides every method Logger and
+// Run actually call, recording failures instead of reporting them.
+type shimTB struct {
+	testing.TB
+	mu  sync.Mutex
+	sig failureSignature
+}
+
+func (s *shimTB) fail(msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sig == "" {
+		s.sig = failureSignature(msg)
+	}
+}
+
+func (s *shimTB) signature() failureSignature {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sig
+}
+
+// Error implements testing.TB.
+func (s *shimTB) Error(args ...any) { s.fail(fmt.Sprint(args...)) }
+
+// Errorf implements testing.TB.
+func (s *shimTB) Errorf(format string, args ...any) { s.fail(fmt.Sprintf(format, args...)) }
+
+// Fatal implements testing.TB.
+func (s *shimTB) Fatal(args ...any) {
+	s.fail(fmt.Sprint(args...))
+	runtime.Goexit()
+}
+
+// Fatalf implements testing.TB.
+func (s *shimTB) Fatalf(format string, args ...any) {
+	s.fail(fmt.Sprintf(format, args...))
+	runtime.Goexit()
+}
+
+// FailNow implements testing.TB.
+func (s *shimTB) FailNow() {
+	s.fail("FailNow")
+	runtime.Goexit()
+}
+
+// Failed implements testing.TB.
+func (s *shimTB) Failed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sig != ""
+}
+
+// Logf implements testing.TB, discarding output so that shrinking trials
+// don't spam the caller's test log.
+func (s *shimTB) Logf(format string, args ...any) {}
+
+// Log implements testing.TB, discarding output.
+func (s *shimTB) Log(args ...any) {}
@@ -0,0 +1,100 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metamorphic
+
+import (
+	"fmt"
+	"testing"
+)
+
+type counterAddOp int
+
+func (o counterAddOp) String() string { return fmt.Sprintf("Add(%d)", int(o)) }
+
+func (o counterAddOp) Run(l *Logger, c *int) {
+	*c += int(o)
+	if *c > 10 {
+		panic("counter exceeded 10")
+	}
+}
+
+func TestShrink(t *testing.T) {
+	newInitial := func() *int {
+		v := 0
+		return &v
+	}
+	ops := []Op[*int]{
+		counterAddOp(1), counterAddOp(1), counterAddOp(1),
+		counterAddOp(20),
+		counterAddOp(1), counterAddOp(1),
+	}
+	got := Shrink(t, newInitial, ops)
+	if len(got) != 1 || got[0] != counterAddOp(20) {
+		t.Errorf("Shrink(ops) = %v, want [Add(20)]", got)
+	}
+}
+
+func TestShrink_NoFailure(t *testing.T) {
+	newInitial := func() *int {
+		v := 0
+		return &v
+	}
+	ops := []Op[*int]{counterAddOp(1), counterAddOp(2)}
+	got := Shrink(t, newInitial, ops)
+	if len(got) != len(ops) {
+		t.Errorf("Shrink(ops) = %v, want ops unchanged since it doesn't fail", got)
+	}
+}
+
+type intAddOp int
+
+func (o intAddOp) String() string { return fmt.Sprintf("Add(%d)", int(o)) }
+
+func (o intAddOp) Run(l *Logger, c *int) { *c += int(o) }
+
+type intGetOp struct{}
+
+func (intGetOp) String() string { return "Get()" }
+
+func (intGetOp) Run(l *Logger, c *int) { l.Logf("%d", *c) }
+
+func TestShrinkTandem(t *testing.T) {
+	// The two tandem states start out with different values, so any
+	// intGetOp diverges. RunInTandem's divergence message embeds both the
+	// op's position and the exact values observed, so -- unlike a
+	// position-independent panic -- the failure signature here changes if
+	// an op preceding the Get is removed; ShrinkTandem can still drop the
+	// trailing, unnecessary Add(4), but can't shrink past the point where
+	// doing so would alter the recorded op index or values.
+	newInitial := func() []*int {
+		a, b := 0, 100
+		return []*int{&a, &b}
+	}
+	ops := []Op[*int]{
+		intAddOp(1), intAddOp(2), intAddOp(3),
+		intGetOp{},
+		intAddOp(4),
+	}
+	want := []Op[*int]{intAddOp(1), intAddOp(2), intAddOp(3), intGetOp{}}
+	got := ShrinkTandem(t, newInitial, ops)
+	if len(got) != len(want) {
+		t.Fatalf("ShrinkTandem(ops) = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("ShrinkTandem(ops)[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
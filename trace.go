@@ -0,0 +1,101 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metamorphic
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+)
+
+// OpCodec encodes and decodes individual operations to and from a binary
+// representation, so that an operation sequence can be persisted with
+// WriteTrace and later replayed with ReadTrace or ReplayFile. Callers
+// supply an OpCodec tailored to their own Op implementation(s).
+type OpCodec[S any] interface {
+	// Encode returns a binary representation of op.
+	Encode(op Op[S]) ([]byte, error)
+	// Decode parses the binary representation produced by Encode.
+	Decode(b []byte) (Op[S], error)
+}
+
+// WriteTrace writes ops to w as a sequence of codec-encoded records, each
+// prefixed with its length, so that ReadTrace can later reconstruct the
+// exact sequence. Traces written by WriteTrace are intended to be
+// committed as corpus files so that a failure found by Run or
+// RunInTandem -- including one minimized by Shrink -- can be reproduced
+// deterministically, including on other machines and in CI.
+func WriteTrace[S any](w io.Writer, ops []Op[S], codec OpCodec[S]) error {
+	var lenBuf [binary.MaxVarintLen64]byte
+	for i, op := range ops {
+		b, err := codec.Encode(op)
+		if err != nil {
+			return errors.Wrapf(err, "encoding op %d", i)
+		}
+		n := binary.PutUvarint(lenBuf[:], uint64(len(b)))
+		if _, err := w.Write(lenBuf[:n]); err != nil {
+			return errors.Wrapf(err, "writing op %d", i)
+		}
+		if _, err := w.Write(b); err != nil {
+			return errors.Wrapf(err, "writing op %d", i)
+		}
+	}
+	return nil
+}
+
+// ReadTrace reads the operation sequence previously written to r by
+// WriteTrace, decoding each record with codec.
+func ReadTrace[S any](r io.Reader, codec OpCodec[S]) ([]Op[S], error) {
+	br := bufio.NewReader(r)
+	var ops []Op[S]
+	for {
+		length, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return ops, nil
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "reading op %d", len(ops))
+		}
+		b := make([]byte, length)
+		if _, err := io.ReadFull(br, b); err != nil {
+			return nil, errors.Wrapf(err, "reading op %d", len(ops))
+		}
+		op, err := codec.Decode(b)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decoding op %d", len(ops))
+		}
+		ops = append(ops, op)
+	}
+}
+
+// ReplayFile reads the operation sequence stored at path, as written by
+// WriteTrace, and runs it against initial using Run. It's intended for
+// re-running a crash-found trace -- committed as a corpus file -- as an
+// ordinary, deterministic test.
+func ReplayFile[S any](t testing.TB, initial S, path string, codec OpCodec[S]) {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("replay: opening %q: %s", path, err)
+	}
+	defer f.Close()
+	ops, err := ReadTrace[S](f, codec)
+	if err != nil {
+		t.Fatalf("replay: reading trace %q: %s", path, err)
+	}
+	Run(t, initial, ops)
+}
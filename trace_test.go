@@ -0,0 +1,83 @@
+// Copyright 2023 The Cockroach Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or
+// implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metamorphic
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type mapOpWire struct {
+	Kind mapOpKind
+	K, V string
+}
+
+type mapOpCodec struct{}
+
+func (mapOpCodec) Encode(op Op[map[string]string]) ([]byte, error) {
+	o := op.(mapOp)
+	return json.Marshal(mapOpWire{Kind: o.kind, K: o.k, V: o.v})
+}
+
+func (mapOpCodec) Decode(b []byte) (Op[map[string]string], error) {
+	var w mapOpWire
+	if err := json.Unmarshal(b, &w); err != nil {
+		return nil, err
+	}
+	return mapOp{kind: w.Kind, k: w.K, v: w.V}, nil
+}
+
+func TestTraceRoundTrip(t *testing.T) {
+	ops := []Op[map[string]string]{
+		mapOp{kind: mapOpPut, k: "foo", v: "bar"},
+		mapOp{kind: mapOpGet, k: "foo"},
+		mapOp{kind: mapOpDel, k: "foo"},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, WriteTrace[map[string]string](&buf, ops, mapOpCodec{}))
+
+	decoded, err := ReadTrace[map[string]string](&buf, mapOpCodec{})
+	require.NoError(t, err)
+	require.Equal(t, ops, decoded)
+}
+
+func TestReplayFile(t *testing.T) {
+	ops := []Op[map[string]string]{
+		mapOp{kind: mapOpPut, k: "foo", v: "bar"},
+		mapOp{kind: mapOpGet, k: "foo"},
+	}
+	path := filepath.Join(t.TempDir(), "trace")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, WriteTrace[map[string]string](f, ops, mapOpCodec{}))
+	require.NoError(t, f.Close())
+
+	ReplayFile(t, make(map[string]string), path, mapOpCodec{})
+}
+
+func TestNewLogger_TeeToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.log")
+	l := NewLogger(t, TeeToFile(path))
+	l.Logf("hello %s", "world")
+
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, l.History(), string(contents))
+}
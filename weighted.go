@@ -14,7 +14,10 @@
 
 package metamorphic
 
-import "math/rand"
+import (
+	"math/rand"
+	"reflect"
+)
 
 // ItemWeight holds an item and its corresponding weight.
 type ItemWeight[I any] struct {
@@ -75,3 +78,134 @@ func (w Weighted[I]) RandomDeck(rng *rand.Rand) func() I {
 		return it
 	}
 }
+
+// RandomDeckSeeded behaves like RandomDeck, but draws from an initial
+// ordering of the deck given by perm instead of shuffling it before the
+// first draw. perm must hold a permutation of [0, w.total()); perm[i]
+// gives the deck position that fills slot i. This makes the sequence
+// returned by the first pass through the deck reproducible across runs
+// that start from the same permutation; every pass after the first is
+// shuffled as usual using rng.
+func (w Weighted[I]) RandomDeckSeeded(rng *rand.Rand, perm []int) func() I {
+	total := w.total()
+	deck := make([]int, 0, total)
+	for i := range w {
+		for j := 0; j < w[i].Weight; j++ {
+			deck = append(deck, i)
+		}
+	}
+	seeded := make([]int, len(deck))
+	for i, p := range perm {
+		seeded[i] = deck[p]
+	}
+	index := 0
+	return func() I {
+		if index == len(seeded) {
+			rng.Shuffle(len(seeded), func(i, j int) {
+				seeded[i], seeded[j] = seeded[j], seeded[i]
+			})
+			index = 0
+		}
+		it := w[seeded[index]].Item
+		index++
+		return it
+	}
+}
+
+// Feedback reports a signal about an item previously drawn from an
+// adaptive deck returned by Weighted.AdaptiveDeck, used to bias future
+// draws toward items that are producing useful results, such as newly
+// observed code coverage or a newly reached assertion state.
+type Feedback[I any] struct {
+	Item        I
+	Interesting bool
+}
+
+// AdaptiveDeckOptions configures the reweighting performed by
+// Weighted.AdaptiveDeck.
+type AdaptiveDeckOptions struct {
+	// Alpha is the smoothing factor of the exponentially-weighted moving
+	// average of "interesting" feedback events maintained per item, in
+	// (0, 1]. Higher values react to recent feedback more aggressively.
+	Alpha float64
+	// RefreshPeriod is the number of draws between deck rebuilds; the
+	// deck's weights only change when it's rebuilt.
+	RefreshPeriod int
+	// MinWeightFraction bounds how far an item's effective weight may
+	// fall below its base weight, expressed as a fraction of the base
+	// weight, to prevent items without recent feedback from starving.
+	MinWeightFraction float64
+}
+
+// DefaultAdaptiveDeckOptions returns reasonable defaults for AdaptiveDeck.
+func DefaultAdaptiveDeckOptions() AdaptiveDeckOptions {
+	return AdaptiveDeckOptions{Alpha: 0.3, RefreshPeriod: 64, MinWeightFraction: 0.1}
+}
+
+// AdaptiveDeck returns a function that returns one item at random, like
+// RandomDeck, except the distribution adapts over time using feedback
+// received on the feedback channel. Each value received is interpreted as
+// a signal about the most recently drawn occurrence of its Item:
+// Interesting=true nudges that item's weight up, via an exponentially-
+// weighted moving average of interesting events (smoothed by
+// opts.Alpha); the deck is rebuilt from the updated weights every
+// opts.RefreshPeriod draws, with weights in proportion to
+// base[i] * (1 + alpha*ema[i]), each floored at opts.MinWeightFraction of
+// the item's base weight. This is
+// analogous to an AFL-style power schedule, letting generation adapt
+// toward operations that are producing novel behavior rather than
+// sampling a fixed, stationary distribution.
+func (w Weighted[I]) AdaptiveDeck(
+	rng *rand.Rand, feedback <-chan Feedback[I], opts AdaptiveDeckOptions,
+) func() I {
+	if opts.RefreshPeriod < 1 {
+		opts.RefreshPeriod = 1
+	}
+	ema := make([]float64, len(w))
+	// Base weights are scaled up before the boost is applied, so that the
+	// fractional part of base[i] * (1 + alpha*ema[i]) isn't truncated
+	// away when converting back to an integer weight (eg, a base weight
+	// of 1 boosted by 1.4 stays 1 without scaling).
+	const scale = 100
+	rebuild := func() func() I {
+		adjusted := make(Weighted[I], len(w))
+		for i := range w {
+			base := float64(w[i].Weight * scale)
+			weight := int(base * (1 + opts.Alpha*ema[i]))
+			if min := int(base * opts.MinWeightFraction); weight < min {
+				weight = min
+			}
+			if weight < 1 {
+				weight = 1
+			}
+			adjusted[i] = ItemWeight[I]{Item: w[i].Item, Weight: weight}
+		}
+		return adjusted.RandomDeck(rng)
+	}
+	next := rebuild()
+	var draws int
+	return func() I {
+		for drained := false; !drained; {
+			select {
+			case fb := <-feedback:
+				for i := range w {
+					if reflect.DeepEqual(w[i].Item, fb.Item) {
+						signal := 0.0
+						if fb.Interesting {
+							signal = 1.0
+						}
+						ema[i] = opts.Alpha*signal + (1-opts.Alpha)*ema[i]
+						break
+					}
+				}
+			default:
+				drained = true
+			}
+		}
+		draws++
+		if draws%opts.RefreshPeriod == 0 {
+			next = rebuild()
+		}
+		return next()
+	}
+}
@@ -53,3 +53,43 @@ func TestWeighted_RandomDeck(t *testing.T) {
 		}
 	}
 }
+
+func TestWeighted_RandomDeckSeeded(t *testing.T) {
+	weighted := Weighted[int]{
+		{Item: 1, Weight: 1},
+		{Item: 2, Weight: 1},
+		{Item: 3, Weight: 1},
+	}
+	rng := rand.New(rand.NewSource(1))
+	next := weighted.RandomDeckSeeded(rng, []int{2, 0, 1})
+	want := []int{3, 1, 2}
+	for i, w := range want {
+		if got := next(); got != w {
+			t.Errorf("draw %d: got %d, want %d", i, got, w)
+		}
+	}
+}
+
+func TestWeighted_AdaptiveDeck(t *testing.T) {
+	weighted := Weighted[int]{
+		{Item: 1, Weight: 1},
+		{Item: 2, Weight: 1},
+	}
+	rng := rand.New(rand.NewSource(1))
+	feedback := make(chan Feedback[int], 1000)
+	opts := AdaptiveDeckOptions{Alpha: 0.5, RefreshPeriod: 4, MinWeightFraction: 0.1}
+	next := weighted.AdaptiveDeck(rng, feedback, opts)
+
+	const draws = 400
+	counts := make(map[int]int)
+	for i := 0; i < draws; i++ {
+		it := next()
+		counts[it]++
+		// Item 1 is reported interesting far more often than item 2, so
+		// the deck should skew toward drawing it.
+		feedback <- Feedback[int]{Item: it, Interesting: it == 1}
+	}
+	if counts[1] <= counts[2] {
+		t.Errorf("expected item 1 to be drawn more often after positive feedback; got %v", counts)
+	}
+}